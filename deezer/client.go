@@ -2,12 +2,16 @@ package deezer
 
 import (
 	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/cookiejar"
 	"net/url"
+	"os"
 	"strings"
 )
 
@@ -30,6 +34,13 @@ const (
 	albumGetData        apiMethod = "album.getData"
 	artistGetData       apiMethod = "artist.getData"
 	albumGetDiscography apiMethod = "album.getDiscography"
+	pagePlaylist        apiMethod = "deezer.pagePlaylist"
+	playlistGetSongs    apiMethod = "playlist.getSongs"
+	userMenu            apiMethod = "deezer.userMenu"
+	userFavoriteSongs   apiMethod = "user.getFavoriteSongs"
+	userFavoriteAlbums  apiMethod = "album.getFavorites"
+	radioGetUpNext      apiMethod = "radio.getUpNext"
+	smartGetSmartRadio  apiMethod = "smart.getSmartRadio"
 )
 
 type songListByAlbumBody struct {
@@ -50,6 +61,39 @@ type userData struct {
 	CheckForm string `json:"checkForm"`
 }
 
+type userMenuData struct {
+	User struct {
+		ID string `json:"USER_ID"`
+	} `json:"USER"`
+}
+
+type pagePlaylistBody struct {
+	ID string `json:"playlist_id"`
+}
+
+type playlistGetSongsBody struct {
+	ID    string `json:"playlist_id"`
+	Limit int    `json:"nb"`
+	Start int    `json:"start"`
+}
+
+type userFavoriteSongsBody struct {
+	UserID string `json:"user_id"`
+}
+
+type userFavoriteAlbumsBody struct {
+	UserID string `json:"user_id"`
+}
+
+type radioGetUpNextBody struct {
+	ID   string `json:"radio_id"`
+	Type string `json:"radio_type"`
+}
+
+type smartGetSmartRadioBody struct {
+	ArtistID string `json:"art_id"`
+}
+
 type response struct {
 	Results json.RawMessage `json:"results"`
 }
@@ -62,6 +106,10 @@ type multiAlbumResponse struct {
 	Data []Album `json:"data"`
 }
 
+type pagePlaylistResponse struct {
+	Data Playlist `json:"DATA"`
+}
+
 type pageSearchBody struct {
 	Query  string `json:"query"`
 	Filter string `json:"filter"`
@@ -85,6 +133,12 @@ type SearchResponse struct {
 type Client struct {
 	*http.Client
 	Arl string
+
+	// rateLimiter and retry hold the config passed to WithRateLimit and
+	// WithRetry, if any; see those for why they're applied after the
+	// opts loop rather than inline.
+	rateLimiter *tokenBucket
+	retry       *retryConfig
 }
 
 // NewClient returns a Deezer client with
@@ -99,6 +153,14 @@ func NewClient(arl string) *Client {
 // This is useful for setting a timeout for requests made by the Client.
 // It will modify the given http.Client's Jar.
 func NewClientWithHTTPClient(arl string, client *http.Client) *Client {
+	return NewClientWithOptions(arl, client)
+}
+
+// NewClientWithOptions returns a Deezer client with the given arl,
+// with opts applied to configure its transport chain (retries, rate
+// limiting, custom http.RoundTrippers, etc). It will modify the given
+// http.Client's Jar.
+func NewClientWithOptions(arl string, client *http.Client, opts ...ClientOption) *Client {
 	jar, err := cookiejar.New(nil)
 	if err != nil {
 		panic(err)
@@ -114,7 +176,21 @@ func NewClientWithHTTPClient(arl string, client *http.Client) *Client {
 		},
 	})
 	client.Jar = jar
-	return &Client{client, arl}
+	c := &Client{Client: client, Arl: arl}
+	for _, opt := range opts {
+		opt(c)
+	}
+	// Applied last and in this fixed order, regardless of the order
+	// WithRateLimit/WithRetry were passed in opts, so that a retried
+	// request always re-enters the rate limiter on each attempt
+	// instead of bypassing it. See WithRetry.
+	if c.rateLimiter != nil {
+		c.Client.Transport = &rateLimitTransport{next: c.transport(), limiter: c.rateLimiter}
+	}
+	if c.retry != nil {
+		c.Client.Transport = &retryTransport{next: c.transport(), maxRetries: c.retry.maxRetries, baseDelay: c.retry.baseDelay}
+	}
+	return c
 }
 
 func (c *Client) do(req *http.Request) (*http.Response, error) {
@@ -124,14 +200,14 @@ func (c *Client) do(req *http.Request) (*http.Response, error) {
 	return c.Client.Do(req)
 }
 
-func (c *Client) apiDo(method apiMethod, body io.Reader) (resp *http.Response, err error) {
-	req, err := http.NewRequest("POST", apiURL, body)
+func (c *Client) apiDo(ctx context.Context, method apiMethod, body io.Reader) (resp *http.Response, err error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", apiURL, body)
 	if err != nil {
 		return nil, err
 	}
 	var token string
 	if method != getUserData {
-		t, err := c.csrfToken()
+		t, err := c.csrfToken(ctx)
 		if err != nil {
 			return nil, err
 		}
@@ -146,20 +222,24 @@ func (c *Client) apiDo(method apiMethod, body io.Reader) (resp *http.Response, e
 	qs.Add("method", string(method))
 	req.URL.RawQuery = qs.Encode()
 	req.AddCookie(&http.Cookie{Name: "arl", Value: c.Arl})
-	r, e := c.do(req)
+	r, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
 	if r.StatusCode < 200 || r.StatusCode > 299 {
+		r.Body.Close()
 		return nil, ErrUnexpectedStatusCode{r.StatusCode}
 	}
-	return r, e
+	return r, nil
 }
 
-func (c *Client) apiDoJSON(method apiMethod, body interface{}, v interface{}) error {
+func (c *Client) apiDoJSON(ctx context.Context, method apiMethod, body interface{}, v interface{}) error {
 	b, err := json.Marshal(body)
 	if err != nil {
 		return err
 	}
 	r := bytes.NewBuffer(b)
-	resp, err := c.apiDo(method, r)
+	resp, err := c.apiDo(ctx, method, r)
 	if err != nil {
 		return err
 	}
@@ -181,27 +261,35 @@ func (c *Client) apiDoJSON(method apiMethod, body interface{}, v interface{}) er
 	return nil
 }
 
-func (c *Client) get(url string) (resp *http.Response, err error) {
-	req, err := http.NewRequest("GET", url, nil)
+func (c *Client) get(ctx context.Context, url string) (resp *http.Response, err error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, err
 	}
 	return c.do(req)
 }
 
-func (c *Client) csrfToken() (string, error) {
+func (c *Client) csrfToken(ctx context.Context) (string, error) {
 	var udata userData
-	err := c.apiDoJSON(getUserData, nil, &udata)
+	err := c.apiDoJSON(ctx, getUserData, nil, &udata)
 	return udata.CheckForm, err
 }
 
+// userID returns the Deezer user id of the account authenticated
+// by the Client's arl, as reported by deezer.userMenu.
+func (c *Client) userID(ctx context.Context) (string, error) {
+	var udata userMenuData
+	err := c.apiDoJSON(ctx, userMenu, nil, &udata)
+	return udata.User.ID, err
+}
+
 // Song fetches a Song.
-func (c *Client) Song(id string) (*Song, error) {
+func (c *Client) Song(ctx context.Context, id string) (*Song, error) {
 	var song Song
 	body := struct {
 		ID string `json:"sng_id"`
 	}{id}
-	err := c.apiDoJSON(songGetData, body, &song)
+	err := c.apiDoJSON(ctx, songGetData, body, &song)
 	if err != nil {
 		return nil, err
 	}
@@ -210,12 +298,12 @@ func (c *Client) Song(id string) (*Song, error) {
 
 // Lyrics fetches a song's lyrics. The ID provided can be from
 // a Song's LyricsID field.
-func (c *Client) Lyrics(id string) (*Lyrics, error) {
+func (c *Client) Lyrics(ctx context.Context, id string) (*Lyrics, error) {
 	var song Lyrics
 	body := struct {
 		ID string `json:"sng_id"`
 	}{id}
-	err := c.apiDoJSON(songGetLyrics, body, &song)
+	err := c.apiDoJSON(ctx, songGetLyrics, body, &song)
 	if err != nil {
 		return nil, err
 	}
@@ -223,12 +311,12 @@ func (c *Client) Lyrics(id string) (*Lyrics, error) {
 }
 
 // Album fetches an Album.
-func (c *Client) Album(id string) (*Album, error) {
+func (c *Client) Album(ctx context.Context, id string) (*Album, error) {
 	var album Album
 	body := struct {
 		ID string `json:"alb_id"`
 	}{id}
-	err := c.apiDoJSON(albumGetData, body, &album)
+	err := c.apiDoJSON(ctx, albumGetData, body, &album)
 	if err != nil {
 		return nil, err
 	}
@@ -236,12 +324,12 @@ func (c *Client) Album(id string) (*Album, error) {
 }
 
 // Artist fetches an Artist.
-func (c *Client) Artist(id string) (*Artist, error) {
+func (c *Client) Artist(ctx context.Context, id string) (*Artist, error) {
 	var artist Artist
 	body := struct {
 		ID string `json:"art_id"`
 	}{id}
-	err := c.apiDoJSON(artistGetData, body, &artist)
+	err := c.apiDoJSON(ctx, artistGetData, body, &artist)
 	if err != nil {
 		return nil, err
 	}
@@ -251,40 +339,107 @@ func (c *Client) Artist(id string) (*Artist, error) {
 // SongsByAlbum fetches up to songLimit songs on an album.
 // If you want to fetch all of the songs on an album,
 // use a songLimit of -1.
-func (c *Client) SongsByAlbum(id string, songLimit int) ([]Song, error) {
+func (c *Client) SongsByAlbum(ctx context.Context, id string, songLimit int) ([]Song, error) {
 	var songs multiSongResponse
 	body := songListByAlbumBody{id, songLimit}
-	err := c.apiDoJSON(songListByAlbum, body, &songs)
+	err := c.apiDoJSON(ctx, songListByAlbum, body, &songs)
 	return songs.Data, err
 }
 
 // AlbumsBy fetches albums in an artist's discography.
-func (c *Client) AlbumsByArtist(id string) ([]Album, error) {
+func (c *Client) AlbumsByArtist(ctx context.Context, id string) ([]Album, error) {
 	var albums multiAlbumResponse
 	body := albumGetDiscographyBody{id, "us", []int{0}, 500, 300, 0}
-	err := c.apiDoJSON(albumGetDiscography, body, &albums)
+	err := c.apiDoJSON(ctx, albumGetDiscography, body, &albums)
 	return albums.Data, err
 }
 
 // Search searches for artists/albums/songs.
-func (c *Client) Search(query, filter, output string, start, limit int) (*SearchResponse, error) {
+func (c *Client) Search(ctx context.Context, query, filter, output string, start, limit int) (*SearchResponse, error) {
 	var resp SearchResponse
 	body := pageSearchBody{query, filter, output, start, limit}
-	err := c.apiDoJSON(pageSearch, body, &resp)
+	err := c.apiDoJSON(ctx, pageSearch, body, &resp)
 	return &resp, err
 }
 
+// Playlist fetches a Playlist, including its full track listing.
+func (c *Client) Playlist(ctx context.Context, id string) (*Playlist, error) {
+	var resp pagePlaylistResponse
+	body := pagePlaylistBody{id}
+	err := c.apiDoJSON(ctx, pagePlaylist, body, &resp)
+	if err != nil {
+		return nil, err
+	}
+	playlist := resp.Data
+	songs, err := c.PlaylistSongs(ctx, id, -1)
+	if err != nil {
+		return nil, err
+	}
+	playlist.Songs.Data = songs
+	return &playlist, nil
+}
+
+// PlaylistSongs fetches up to songLimit songs on a playlist.
+// If you want to fetch all of the songs on a playlist,
+// use a songLimit of -1.
+func (c *Client) PlaylistSongs(ctx context.Context, id string, songLimit int) ([]Song, error) {
+	var songs multiSongResponse
+	body := playlistGetSongsBody{id, songLimit, 0}
+	err := c.apiDoJSON(ctx, playlistGetSongs, body, &songs)
+	return songs.Data, err
+}
+
+// FavoriteSongs fetches the songs favorited by the logged in user.
+func (c *Client) FavoriteSongs(ctx context.Context) ([]Song, error) {
+	id, err := c.userID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var songs multiSongResponse
+	body := userFavoriteSongsBody{id}
+	err = c.apiDoJSON(ctx, userFavoriteSongs, body, &songs)
+	return songs.Data, err
+}
+
+// FavoriteAlbums fetches the albums favorited by the logged in user.
+func (c *Client) FavoriteAlbums(ctx context.Context) ([]Album, error) {
+	id, err := c.userID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var albums multiAlbumResponse
+	body := userFavoriteAlbumsBody{id}
+	err = c.apiDoJSON(ctx, userFavoriteAlbums, body, &albums)
+	return albums.Data, err
+}
+
+// UpNext fetches the next songs in a radio's flow stream.
+func (c *Client) UpNext(ctx context.Context, radioID, radioType string) ([]Song, error) {
+	var songs multiSongResponse
+	body := radioGetUpNextBody{radioID, radioType}
+	err := c.apiDoJSON(ctx, radioGetUpNext, body, &songs)
+	return songs.Data, err
+}
+
+// SmartRadio fetches a smart radio mix built around an artist.
+func (c *Client) SmartRadio(ctx context.Context, artistID string) ([]Song, error) {
+	var songs multiSongResponse
+	body := smartGetSmartRadioBody{artistID}
+	err := c.apiDoJSON(ctx, smartGetSmartRadio, body, &songs)
+	return songs.Data, err
+}
+
 // AvailableQualities returns the available qualities for download
 // of a song.
-func (c *Client) AvailableQualities(song Song) []Quality {
+func (c *Client) AvailableQualities(ctx context.Context, song Song) []Quality {
 	var qualities []Quality
-	if c.IsQualityAvailable(song, MP3128) {
+	if c.IsQualityAvailable(ctx, song, MP3128) {
 		qualities = append(qualities, MP3128)
 	}
-	if c.IsQualityAvailable(song, MP3320) {
+	if c.IsQualityAvailable(ctx, song, MP3320) {
 		qualities = append(qualities, MP3320)
 	}
-	if c.IsQualityAvailable(song, FLAC) {
+	if c.IsQualityAvailable(ctx, song, FLAC) {
 		qualities = append(qualities, FLAC)
 	}
 	return qualities
@@ -292,12 +447,12 @@ func (c *Client) AvailableQualities(song Song) []Quality {
 
 // IsQualityAvailable returns whether or not a song is available
 // to download for a song.
-func (c *Client) IsQualityAvailable(song Song, quality Quality) bool {
+func (c *Client) IsQualityAvailable(ctx context.Context, song Song, quality Quality) bool {
 	url := song.DownloadURL(quality)
 	if url == "" {
 		return false
 	}
-	resp, err := c.get(url)
+	resp, err := c.get(ctx, url)
 	if err != nil {
 		return false
 	}
@@ -308,49 +463,73 @@ func (c *Client) IsQualityAvailable(song Song, quality Quality) bool {
 	return true
 }
 
-type songDownloadReader struct {
-	r    *DecryptingReader
-	body io.ReadCloser
-}
-
-func (s songDownloadReader) Read(p []byte) (int, error) {
-	return s.r.Read(p)
-}
-
-func (s songDownloadReader) Close() error {
-	return s.body.Close()
-}
+// Write writes a song from Deezer at a given quality to w, fetching the
+// encrypted stream across concurrent range requests aligned to
+// chunkAlignment and writing each range to w, decrypted, as soon as
+// every range before it has landed. If w is an *os.File with existing
+// content (e.g. from an interrupted previous call), Write resumes from
+// its current size rounded down to chunkAlignment instead of
+// redownloading from the start; in that
+// case the post-download MD5 check against s.MD5Origin is skipped,
+// since it can only be computed over a full download. The download can
+// be cancelled by cancelling ctx.
+func (s Song) Write(ctx context.Context, w io.Writer, quality Quality, opts ...DownloadOptions) error {
+	var opt DownloadOptions
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
 
-// Write writes a song from Deezer at a given quality to w.
-func (s Song) Write(w io.Writer, quality Quality) error {
 	url := s.DownloadURL(quality)
-	resp, err := http.Get(url)
+	total, err := contentLength(ctx, http.DefaultClient, url)
 	if err != nil {
 		return err
 	}
-	defer resp.Body.Close()
-	if resp.StatusCode < 200 || resp.StatusCode > 299 {
-		return ErrUnexpectedStatusCode{resp.StatusCode}
+
+	var start int64
+	if f, ok := w.(*os.File); ok {
+		if info, statErr := f.Stat(); statErr == nil && info.Size() > 0 {
+			if info.Size() >= total {
+				// Already fully downloaded: fetching [total, total) would
+				// be a zero-length, inverted Range header, which real
+				// servers reject with 416 rather than no-op.
+				return nil
+			}
+			start = alignDown(info.Size(), chunkAlignment)
+			if _, err := f.Seek(start, io.SeekStart); err != nil {
+				return err
+			}
+		}
 	}
-	r, err := NewDecryptingReader(resp.Body, s.ID)
-	if err != nil {
+
+	if start > 0 {
+		return fetchRangesTo(ctx, http.DefaultClient, url, start, total, s.ID, w, opt)
+	}
+
+	hash := md5.New()
+	if err := fetchRangesTo(ctx, http.DefaultClient, url, 0, total, s.ID, io.MultiWriter(w, hash), opt); err != nil {
 		return err
 	}
-	_, err = io.Copy(w, r)
-	return err
+	if s.MD5Origin != "" && !strings.EqualFold(hex.EncodeToString(hash.Sum(nil)), s.MD5Origin) {
+		return fmt.Errorf("deezer: downloaded song failed MD5 integrity check")
+	}
+	return nil
 }
 
 // Download returns an io.ReadCloser from which the song can be read at the
 // given quality. This function is deprecated and it is preferred to use song.Write
-func (c *Client) Download(song Song, quality Quality) (io.ReadCloser, error) {
+func (c *Client) Download(ctx context.Context, song Song, quality Quality, opts ...DownloadOptions) (io.ReadCloser, error) {
+	var opt DownloadOptions
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
 	url := song.DownloadURL(quality)
-	resp, err := c.get(url)
+	total, err := contentLength(ctx, c.Client, url)
 	if err != nil {
 		return nil, err
 	}
-	if resp.StatusCode < 200 || resp.StatusCode > 299 {
-		return nil, ErrUnexpectedStatusCode{resp.StatusCode}
-	}
-	r, err := NewDecryptingReader(resp.Body, song.ID)
-	return songDownloadReader{r, resp.Body}, err
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(fetchRangesTo(ctx, c.Client, url, 0, total, song.ID, pw, opt))
+	}()
+	return pr, nil
 }
@@ -0,0 +1,12 @@
+package deezer
+
+import "fmt"
+
+// CoverURL returns the URL of this album's cover art at size x size
+// pixels, using Deezer's static image CDN.
+func (a Album) CoverURL(size int) string {
+	if a.CoverID == "" {
+		return ""
+	}
+	return fmt.Sprintf("https://e-cdns-images.dzcdn.net/images/cover/%s/%dx%d-000000-80-0-0.jpg", a.CoverID, size, size)
+}
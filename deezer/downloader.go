@@ -0,0 +1,184 @@
+package deezer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// chunkAlignment is the size of a Blowfish CBC chunk group. The cipher
+// only touches every 3rd 2048-byte chunk, so any byte range fetched
+// independently must start on a multiple of this size for the
+// decryptor to see the same encrypt/plain/plain pattern it would from
+// the start of the file.
+const chunkAlignment = 3 * 2048
+
+// ProgressFunc is called as a song download progresses, reporting the
+// number of (still-encrypted) bytes fetched so far and the total size.
+type ProgressFunc func(bytesDone, bytesTotal int64)
+
+// DownloadOptions configures the concurrent downloader used by
+// Song.Write and Client.Download.
+type DownloadOptions struct {
+	// Concurrency is the number of byte ranges fetched in parallel.
+	// Defaults to 4 if zero.
+	Concurrency int
+	// Progress, if non-nil, is called as the download progresses.
+	Progress ProgressFunc
+}
+
+func (o DownloadOptions) concurrency() int {
+	if o.Concurrency > 0 {
+		return o.Concurrency
+	}
+	return 4
+}
+
+type byteRange struct{ start, end int64 } // [start, end)
+
+// contentLength HEADs url to discover the size of the encrypted song.
+func contentLength(ctx context.Context, client *http.Client, url string) (int64, error) {
+	req, err := http.NewRequestWithContext(ctx, "HEAD", url, nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return 0, ErrUnexpectedStatusCode{resp.StatusCode}
+	}
+	return strconv.ParseInt(resp.Header.Get("Content-Length"), 10, 64)
+}
+
+// alignedRanges splits [start, total) into n parts (fewer if the span is
+// too short to give each part at least chunkAlignment bytes), with
+// internal boundaries rounded down to a multiple of chunkAlignment; the
+// last part absorbs the remainder. It returns
+// no ranges at all if start >= total: there is nothing left to fetch,
+// and a zero-length range would produce an inverted, malformed Range
+// header.
+func alignedRanges(start, total int64, n int) []byteRange {
+	if start >= total {
+		return nil
+	}
+	size := total - start
+	if n < 1 || size <= chunkAlignment {
+		return []byteRange{{start, total}}
+	}
+	step := size / int64(n)
+	step -= step % chunkAlignment
+	if step == 0 {
+		step = chunkAlignment
+	}
+	ranges := make([]byteRange, 0, n)
+	for s := start; s < total && len(ranges) < n; s += step {
+		e := s + step
+		if e > total {
+			e = total
+		}
+		ranges = append(ranges, byteRange{s, e})
+	}
+	ranges[len(ranges)-1].end = total
+	return ranges
+}
+
+// fetchRange downloads a single byte range of url into memory.
+func fetchRange(ctx context.Context, client *http.Client, url string, rg byteRange) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", rg.start, rg.end-1))
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusPartialContent && resp.StatusCode != http.StatusOK {
+		return nil, ErrUnexpectedStatusCode{resp.StatusCode}
+	}
+	buf := make([]byte, rg.end-rg.start)
+	if _, err := io.ReadFull(resp.Body, buf); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// fetchRangesTo downloads [start, total) of url across opt.concurrency()
+// concurrent range requests, decrypting each range with its own
+// windowed DecryptingReader (safe because ranges are aligned to
+// chunkAlignment) and writing it to w strictly in range order as it
+// arrives. Ranges download out of order, but nothing is written for
+// range N+1 until range N has landed, so if ctx is cancelled or the
+// process dies mid-download, w is left holding a contiguous prefix
+// that a later call can resume from. Each range is held in memory from
+// the time it lands until it is written, so up to the whole of
+// [start, total) can be buffered at once.
+func fetchRangesTo(ctx context.Context, client *http.Client, url string, start, total int64, songID string, w io.Writer, opt DownloadOptions) error {
+	ranges := alignedRanges(start, total, opt.concurrency())
+	fetched := make([][]byte, len(ranges))
+	landed := make([]chan struct{}, len(ranges))
+	for i := range landed {
+		landed[i] = make(chan struct{})
+	}
+
+	g, ctx := errgroup.WithContext(ctx)
+	sem := make(chan struct{}, opt.concurrency())
+	for i, rg := range ranges {
+		i, rg := i, rg
+		g.Go(func() error {
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			defer func() { <-sem }()
+			buf, err := fetchRange(ctx, client, url, rg)
+			if err != nil {
+				return err
+			}
+			fetched[i] = buf
+			close(landed[i])
+			return nil
+		})
+	}
+
+	g.Go(func() error {
+		var done int64
+		for i, rg := range ranges {
+			select {
+			case <-landed[i]:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			r, err := NewDecryptingReader(bytes.NewReader(fetched[i]), songID)
+			if err != nil {
+				return err
+			}
+			if _, err := io.Copy(w, r); err != nil {
+				return err
+			}
+			fetched[i] = nil
+			done += rg.end - rg.start
+			if opt.Progress != nil {
+				opt.Progress(start+done, total)
+			}
+		}
+		return nil
+	})
+
+	return g.Wait()
+}
+
+// alignDown rounds n down to the nearest multiple of align.
+func alignDown(n, align int64) int64 {
+	return n - n%align
+}
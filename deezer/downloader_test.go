@@ -0,0 +1,53 @@
+package deezer
+
+import "testing"
+
+func TestAlignedRangesChunkAlignment(t *testing.T) {
+	const total = 100_000
+	for _, n := range []int{1, 2, 4, 8} {
+		ranges := alignedRanges(0, total, n)
+		if len(ranges) == 0 {
+			t.Fatalf("concurrency %d: got no ranges for a non-empty file", n)
+		}
+		for i, rg := range ranges {
+			if i > 0 && rg.start%chunkAlignment != 0 {
+				t.Errorf("concurrency %d: range %d starts at %d, not aligned to %d", n, i, rg.start, chunkAlignment)
+			}
+			if rg.start >= rg.end {
+				t.Errorf("concurrency %d: range %d is empty or inverted: [%d, %d)", n, i, rg.start, rg.end)
+			}
+		}
+		if first, last := ranges[0].start, ranges[len(ranges)-1].end; first != 0 || last != total {
+			t.Errorf("concurrency %d: ranges don't cover [0, %d): got [%d, %d)", n, total, first, last)
+		}
+		for i := 1; i < len(ranges); i++ {
+			if ranges[i-1].end != ranges[i].start {
+				t.Errorf("concurrency %d: gap or overlap between range %d and %d: %d != %d", n, i-1, i, ranges[i-1].end, ranges[i].start)
+			}
+		}
+	}
+}
+
+func TestAlignedRangesResumeIntoCompleteFile(t *testing.T) {
+	if ranges := alignedRanges(100_000, 100_000, 4); ranges != nil {
+		t.Errorf("start == total: got %v, want nil", ranges)
+	}
+	if ranges := alignedRanges(100_001, 100_000, 4); ranges != nil {
+		t.Errorf("start > total: got %v, want nil", ranges)
+	}
+}
+
+func TestAlignDown(t *testing.T) {
+	cases := []struct{ n, align, want int64 }{
+		{0, chunkAlignment, 0},
+		{1, chunkAlignment, 0},
+		{chunkAlignment, chunkAlignment, chunkAlignment},
+		{chunkAlignment + 1, chunkAlignment, chunkAlignment},
+		{2*chunkAlignment - 1, chunkAlignment, chunkAlignment},
+	}
+	for _, c := range cases {
+		if got := alignDown(c.n, c.align); got != c.want {
+			t.Errorf("alignDown(%d, %d) = %d, want %d", c.n, c.align, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package gateway
+
+import (
+	"context"
+	"net/url"
+
+	"github.com/GoDeezer/lib/deezer"
+)
+
+// subsonicArtist is the "artist" element Subsonic clients expect from
+// getArtist and search3.
+type subsonicArtist struct {
+	ID         string          `json:"id"`
+	Name       string          `json:"name"`
+	AlbumCount int             `json:"albumCount"`
+	Album      []subsonicAlbum `json:"album,omitempty"`
+}
+
+// subsonicAlbum is the "album" element Subsonic clients expect from
+// getAlbum and search3.
+type subsonicAlbum struct {
+	ID         string         `json:"id"`
+	Name       string         `json:"name"`
+	Artist     string         `json:"artist"`
+	ArtistID   string         `json:"artistId"`
+	CoverArt   string         `json:"coverArt,omitempty"`
+	SongCount  int            `json:"songCount"`
+	Song       []subsonicSong `json:"song,omitempty"`
+}
+
+// subsonicSong is the "song" element Subsonic clients expect from
+// getAlbum, search3, and as the basis for stream/getCoverArt requests.
+type subsonicSong struct {
+	ID          string `json:"id"`
+	Title       string `json:"title"`
+	Album       string `json:"album"`
+	AlbumID     string `json:"albumId"`
+	Artist      string `json:"artist"`
+	ArtistID    string `json:"artistId"`
+	Track       int    `json:"track,omitempty"`
+	DiscNumber  int    `json:"discNumber,omitempty"`
+	Duration    int    `json:"duration,omitempty"`
+	CoverArt    string `json:"coverArt,omitempty"`
+	Suffix      string `json:"suffix"`
+	ContentType string `json:"contentType"`
+	IsDir       bool   `json:"isDir"`
+}
+
+// toSubsonicSong maps a Deezer song onto its Subsonic representation.
+// Suffix/ContentType are derived from the quality /stream would
+// actually pick for this song with no maxBitRate limit (its highest
+// available), so clients that read format from metadata agree with
+// what hitting /stream for it returns.
+func toSubsonicSong(ctx context.Context, client *deezer.Client, s deezer.Song) subsonicSong {
+	suffix, contentType := "mp3", "audio/mpeg"
+	if available := client.AvailableQualities(ctx, s); len(available) > 0 {
+		suffix, contentType = suffixAndContentType(pickQuality(available, 0))
+	}
+	return subsonicSong{
+		ID:          s.ID,
+		Title:       s.Title,
+		Album:       s.Album.Title,
+		AlbumID:     s.Album.ID,
+		Artist:      s.Artist.Name,
+		ArtistID:    s.Artist.ID,
+		Track:       s.TrackNumber,
+		DiscNumber:  s.DiscNumber,
+		Duration:    s.Duration,
+		CoverArt:    "al-" + s.Album.ID,
+		Suffix:      suffix,
+		ContentType: contentType,
+	}
+}
+
+func toSubsonicAlbum(ctx context.Context, client *deezer.Client, a deezer.Album, songs []deezer.Song) subsonicAlbum {
+	out := subsonicAlbum{
+		ID:        a.ID,
+		Name:      a.Title,
+		Artist:    a.Artist.Name,
+		ArtistID:  a.Artist.ID,
+		CoverArt:  "al-" + a.ID,
+		SongCount: len(songs),
+	}
+	for _, s := range songs {
+		out.Song = append(out.Song, toSubsonicSong(ctx, client, s))
+	}
+	return out
+}
+
+func toSubsonicArtist(ctx context.Context, client *deezer.Client, a deezer.Artist, albums []deezer.Album) subsonicArtist {
+	out := subsonicArtist{
+		ID:         a.ID,
+		Name:       a.Name,
+		AlbumCount: len(albums),
+	}
+	for _, al := range albums {
+		out.Album = append(out.Album, toSubsonicAlbum(ctx, client, al, nil))
+	}
+	return out
+}
+
+// handleGetArtist implements getArtist, returning an artist and its
+// discography.
+func (s *Server) handleGetArtist(ctx context.Context, q url.Values) (interface{}, error) {
+	id := q.Get("id")
+	if id == "" {
+		return nil, subsonicErr{errRequiredParamMiss, "Required parameter id is missing"}
+	}
+	artist, err := s.Client.Artist(ctx, id)
+	if err != nil {
+		return nil, subsonicErr{errDataNotFound, err.Error()}
+	}
+	albums, err := s.Client.AlbumsByArtist(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"artist": toSubsonicArtist(ctx, s.Client, *artist, albums)}, nil
+}
+
+// handleGetAlbum implements getAlbum, returning an album and its
+// tracklist.
+func (s *Server) handleGetAlbum(ctx context.Context, q url.Values) (interface{}, error) {
+	id := q.Get("id")
+	if id == "" {
+		return nil, subsonicErr{errRequiredParamMiss, "Required parameter id is missing"}
+	}
+	album, err := s.Client.Album(ctx, id)
+	if err != nil {
+		return nil, subsonicErr{errDataNotFound, err.Error()}
+	}
+	songs, err := s.Client.SongsByAlbum(ctx, id, -1)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"album": toSubsonicAlbum(ctx, s.Client, *album, songs)}, nil
+}
+
+// handleSearch3 implements search3, mapping Deezer's combined
+// artist/album/track search onto Subsonic's searchResult3.
+func (s *Server) handleSearch3(ctx context.Context, q url.Values) (interface{}, error) {
+	query := q.Get("query")
+	if query == "" {
+		return nil, subsonicErr{errRequiredParamMiss, "Required parameter query is missing"}
+	}
+	resp, err := s.Client.Search(ctx, query, "ALL", "SONG", 0, 50)
+	if err != nil {
+		return nil, err
+	}
+
+	result := map[string]interface{}{}
+	artists := make([]subsonicArtist, 0, len(resp.Artists.Data))
+	for _, a := range resp.Artists.Data {
+		artists = append(artists, toSubsonicArtist(ctx, s.Client, a, nil))
+	}
+	if len(artists) > 0 {
+		result["artist"] = artists
+	}
+	albums := make([]subsonicAlbum, 0, len(resp.Albums.Data))
+	for _, a := range resp.Albums.Data {
+		albums = append(albums, toSubsonicAlbum(ctx, s.Client, a, nil))
+	}
+	if len(albums) > 0 {
+		result["album"] = albums
+	}
+	songs := make([]subsonicSong, 0, len(resp.Songs.Data))
+	for _, sg := range resp.Songs.Data {
+		songs = append(songs, toSubsonicSong(ctx, s.Client, sg))
+	}
+	if len(songs) > 0 {
+		result["song"] = songs
+	}
+	return map[string]interface{}{"searchResult3": result}, nil
+}
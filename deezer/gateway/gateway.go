@@ -0,0 +1,173 @@
+// Package gateway exposes a deezer.Client over a local HTTP server
+// implementing a subset of the Subsonic API, so that existing Subsonic
+// clients (DSub, play:Sub, Symfonium, Navidrome-compatible frontends)
+// can browse and stream a Deezer account without knowing it's Deezer
+// underneath.
+//
+// Only the endpoints needed for browsing and playback are implemented:
+// ping.view, getArtist, getAlbum, search3, stream, getCoverArt, and
+// getLyrics. Responses are always JSON (the `f=xml` form is not
+// supported).
+package gateway
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/GoDeezer/lib/deezer"
+)
+
+// apiVersion is the Subsonic REST API version this gateway claims to
+// implement, reported back in every response envelope.
+const apiVersion = "1.16.1"
+
+// Server adapts a deezer.Client to the Subsonic API over HTTP.
+type Server struct {
+	Client *deezer.Client
+
+	// Username and Password, if either is non-empty, are required to
+	// match the `u` and `p` query parameters of every request (the plain
+	// or "enc:"-hex-prefixed form used by Subsonic clients). If both are
+	// empty, authentication is skipped, which is only appropriate
+	// behind a trusted local/VPN network.
+	Username string
+	Password string
+}
+
+// NewServer returns a Server that answers Subsonic requests using
+// client.
+func NewServer(client *deezer.Client) *Server {
+	return &Server{Client: client}
+}
+
+// Handler returns an http.Handler serving the Subsonic endpoints under
+// "/rest/", ready to be passed to http.ListenAndServe or mounted
+// alongside other routes.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/rest/ping.view", s.wrap(s.handlePing))
+	mux.HandleFunc("/rest/getArtist.view", s.wrap(s.handleGetArtist))
+	mux.HandleFunc("/rest/getAlbum.view", s.wrap(s.handleGetAlbum))
+	mux.HandleFunc("/rest/search3.view", s.wrap(s.handleSearch3))
+	mux.HandleFunc("/rest/getLyrics.view", s.wrap(s.handleGetLyrics))
+	// stream and getCoverArt write raw media bytes rather than a
+	// Subsonic JSON envelope, so they handle auth and errors themselves
+	// instead of going through wrap.
+	mux.HandleFunc("/rest/stream.view", s.handleStream)
+	mux.HandleFunc("/rest/getCoverArt.view", s.handleGetCoverArt)
+	return mux
+}
+
+// handlePing implements ping.view, the liveness check every Subsonic
+// client issues before anything else.
+func (s *Server) handlePing(ctx context.Context, q url.Values) (interface{}, error) {
+	return nil, nil
+}
+
+// subsonicError is a Subsonic API error code, as embedded in an error
+// envelope's "error" field.
+type subsonicError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// Subsonic error codes used by this gateway. The full list has more
+// entries than we need; see the Subsonic API docs for the rest.
+const (
+	errGeneric           = 0
+	errRequiredParamMiss = 10
+	errWrongCredentials  = 40
+	errDataNotFound      = 70
+)
+
+// handlerFunc is a Subsonic endpoint handler. It returns the value to
+// embed in the "subsonic-response" envelope, or an error to report
+// through it instead.
+type handlerFunc func(ctx context.Context, q url.Values) (interface{}, error)
+
+// wrap adapts a handlerFunc to http.HandlerFunc: it authenticates the
+// request, invokes fn, and writes the Subsonic JSON envelope.
+func (s *Server) wrap(fn handlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if err := s.authenticate(q); err != nil {
+			writeError(w, err)
+			return
+		}
+		payload, err := fn(r.Context(), q)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeOK(w, payload)
+	}
+}
+
+// authenticate checks the `u`/`p` query parameters against the
+// Server's configured credentials, if any are configured.
+func (s *Server) authenticate(q url.Values) error {
+	if s.Username == "" && s.Password == "" {
+		return nil
+	}
+	if q.Get("u") != s.Username || decodePassword(q.Get("p")) != s.Password {
+		return subsonicErr{errWrongCredentials, "Wrong username or password"}
+	}
+	return nil
+}
+
+// decodePassword undoes Subsonic's "enc:<hex>" password obfuscation,
+// used by clients that don't send the password in the clear.
+func decodePassword(p string) string {
+	const prefix = "enc:"
+	if !strings.HasPrefix(p, prefix) {
+		return p
+	}
+	b, err := hex.DecodeString(strings.TrimPrefix(p, prefix))
+	if err != nil {
+		return p
+	}
+	return string(b)
+}
+
+// subsonicErr is an error carrying a Subsonic error code, returned by
+// handlers so wrap can translate it into an error envelope.
+type subsonicErr struct {
+	code    int
+	message string
+}
+
+func (e subsonicErr) Error() string { return e.message }
+
+func writeOK(w http.ResponseWriter, payload interface{}) {
+	envelope := map[string]interface{}{
+		"status":  "ok",
+		"version": apiVersion,
+	}
+	if m, ok := payload.(map[string]interface{}); ok {
+		for k, v := range m {
+			envelope[k] = v
+		}
+	}
+	writeEnvelope(w, envelope)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	se, ok := err.(subsonicErr)
+	if !ok {
+		se = subsonicErr{errGeneric, err.Error()}
+	}
+	writeEnvelope(w, map[string]interface{}{
+		"status":  "failed",
+		"version": apiVersion,
+		"error":   subsonicError{se.code, se.message},
+	})
+}
+
+func writeEnvelope(w http.ResponseWriter, envelope map[string]interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"subsonic-response": envelope})
+}
@@ -0,0 +1,151 @@
+package gateway
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/GoDeezer/lib/deezer"
+)
+
+// bitRateOf returns the approximate kbps of a Quality, used to compare
+// against a client's requested maxBitRate.
+func bitRateOf(q deezer.Quality) int {
+	switch q {
+	case deezer.FLAC:
+		return 1411
+	case deezer.MP3320:
+		return 320
+	case deezer.MP3128:
+		return 128
+	default:
+		return 0
+	}
+}
+
+// suffixAndContentType returns the file extension and MIME type that
+// /stream will actually serve a song at quality q, so callers
+// advertising a song's metadata (getArtist, getAlbum, search3) can keep
+// it consistent with what streaming it will return.
+func suffixAndContentType(q deezer.Quality) (suffix, contentType string) {
+	if q == deezer.FLAC {
+		return "flac", "audio/flac"
+	}
+	return "mp3", "audio/mpeg"
+}
+
+// pickQuality returns the best of the available qualities that fits
+// within maxBitRate, honoring Subsonic's "?maxBitRate=" convention
+// where 0 (or absent) means no limit. available is assumed ordered
+// from lowest to highest bitrate, as Client.AvailableQualities returns
+// it.
+func pickQuality(available []deezer.Quality, maxBitRate int) deezer.Quality {
+	if maxBitRate <= 0 {
+		return available[len(available)-1]
+	}
+	best := available[0]
+	for _, q := range available {
+		if bitRateOf(q) <= maxBitRate {
+			best = q
+		}
+	}
+	return best
+}
+
+func (s *Server) handleStream(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if err := s.authenticate(q); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	id := q.Get("id")
+	if id == "" {
+		http.Error(w, "missing id", http.StatusBadRequest)
+		return
+	}
+	song, err := s.Client.Song(r.Context(), id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	available := s.Client.AvailableQualities(r.Context(), *song)
+	if len(available) == 0 {
+		http.Error(w, "no stream available for this track", http.StatusNotFound)
+		return
+	}
+	maxBitRate, _ := strconv.Atoi(q.Get("maxBitRate"))
+	quality := pickQuality(available, maxBitRate)
+
+	_, contentType := suffixAndContentType(quality)
+	w.Header().Set("Content-Type", contentType)
+	if err := song.Write(r.Context(), w, quality); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func (s *Server) handleGetCoverArt(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if err := s.authenticate(q); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	id := strings.TrimPrefix(q.Get("id"), "al-")
+	if id == "" {
+		http.Error(w, "missing id", http.StatusBadRequest)
+		return
+	}
+	size, err := strconv.Atoi(q.Get("size"))
+	if err != nil || size <= 0 {
+		size = 600
+	}
+	album, err := s.Client.Album(r.Context(), id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	coverURL := album.CoverURL(size)
+	if coverURL == "" {
+		http.Error(w, "no cover art for this album", http.StatusNotFound)
+		return
+	}
+	req, err := http.NewRequestWithContext(r.Context(), "GET", coverURL, nil)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+	w.Header().Set("Content-Type", resp.Header.Get("Content-Type"))
+	io.Copy(w, resp.Body)
+}
+
+// handleGetLyrics implements a simplified getLyrics: unlike the
+// classic Subsonic endpoint, which looks a song up by artist/title,
+// this takes the Deezer song id directly in "id", since callers
+// already have it from a prior getAlbum/search3 response.
+func (s *Server) handleGetLyrics(ctx context.Context, q url.Values) (interface{}, error) {
+	id := q.Get("id")
+	if id == "" {
+		return nil, subsonicErr{errRequiredParamMiss, "Required parameter id is missing"}
+	}
+	song, err := s.Client.Song(ctx, id)
+	if err != nil {
+		return nil, subsonicErr{errDataNotFound, err.Error()}
+	}
+	lyrics, err := s.Client.Lyrics(ctx, song.LyricsID)
+	if err != nil {
+		return nil, subsonicErr{errDataNotFound, err.Error()}
+	}
+	return map[string]interface{}{"lyrics": map[string]interface{}{
+		"artist": song.Artist.Name,
+		"title":  song.Title,
+		"value":  lyrics.Text,
+	}}, nil
+}
@@ -0,0 +1,70 @@
+package gateway
+
+import (
+	"testing"
+
+	"github.com/GoDeezer/lib/deezer"
+)
+
+func TestPickQualityNoLimit(t *testing.T) {
+	available := []deezer.Quality{deezer.MP3128, deezer.MP3320, deezer.FLAC}
+	if got := pickQuality(available, 0); got != deezer.FLAC {
+		t.Errorf("pickQuality(%v, 0) = %v, want FLAC", available, got)
+	}
+}
+
+func TestPickQualityWithinLimit(t *testing.T) {
+	available := []deezer.Quality{deezer.MP3128, deezer.MP3320, deezer.FLAC}
+	cases := []struct {
+		maxBitRate int
+		want       deezer.Quality
+	}{
+		{128, deezer.MP3128},
+		{192, deezer.MP3128},
+		{320, deezer.MP3320},
+		{2000, deezer.FLAC},
+	}
+	for _, c := range cases {
+		if got := pickQuality(available, c.maxBitRate); got != c.want {
+			t.Errorf("pickQuality(%v, %d) = %v, want %v", available, c.maxBitRate, got, c.want)
+		}
+	}
+}
+
+func TestPickQualityBelowLowestFallsBackToLowest(t *testing.T) {
+	available := []deezer.Quality{deezer.MP3320, deezer.FLAC}
+	if got := pickQuality(available, 64); got != deezer.MP3320 {
+		t.Errorf("pickQuality(%v, 64) = %v, want the lowest available quality", available, got)
+	}
+}
+
+func TestSuffixAndContentType(t *testing.T) {
+	if suffix, ct := suffixAndContentType(deezer.FLAC); suffix != "flac" || ct != "audio/flac" {
+		t.Errorf("suffixAndContentType(FLAC) = %q, %q, want \"flac\", \"audio/flac\"", suffix, ct)
+	}
+	for _, q := range []deezer.Quality{deezer.MP3128, deezer.MP3320} {
+		if suffix, ct := suffixAndContentType(q); suffix != "mp3" || ct != "audio/mpeg" {
+			t.Errorf("suffixAndContentType(%v) = %q, %q, want \"mp3\", \"audio/mpeg\"", q, suffix, ct)
+		}
+	}
+}
+
+func TestDecodePasswordPlain(t *testing.T) {
+	if got := decodePassword("hunter2"); got != "hunter2" {
+		t.Errorf("decodePassword(plain) = %q, want unchanged", got)
+	}
+}
+
+func TestDecodePasswordEncoded(t *testing.T) {
+	// "enc:" + hex("hunter2")
+	if got := decodePassword("enc:68756e74657232"); got != "hunter2" {
+		t.Errorf("decodePassword(enc:...) = %q, want %q", got, "hunter2")
+	}
+}
+
+func TestDecodePasswordMalformedHexFallsBackToInput(t *testing.T) {
+	const malformed = "enc:zz"
+	if got := decodePassword(malformed); got != malformed {
+		t.Errorf("decodePassword(%q) = %q, want the input returned unchanged", malformed, got)
+	}
+}
@@ -0,0 +1,12 @@
+package deezer
+
+// Playlist represents a Deezer playlist.
+type Playlist struct {
+	ID          string `json:"playlist_id"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	NbSongs     int    `json:"nb_songs"`
+	Songs       struct {
+		Data []Song `json:"data"`
+	} `json:"songs"`
+}
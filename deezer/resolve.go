@@ -0,0 +1,135 @@
+package deezer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// publicAPIURL is Deezer's public REST API, used only to translate an
+// ISRC or UPC into the numeric id that the gw-light methods expect.
+const publicAPIURL = "https://api.deezer.com"
+
+// Resource is a single entity resolved from a Deezer URL or identifier.
+// Exactly one field is non-nil.
+type Resource struct {
+	Song     *Song
+	Album    *Album
+	Artist   *Artist
+	Playlist *Playlist
+}
+
+var (
+	shortLinkHost = "deezer.page.link"
+	resourcePath  = regexp.MustCompile(`/(track|album|artist|playlist)/(\d+)`)
+	lovedPath     = regexp.MustCompile(`/user/(\d+)/loved`)
+)
+
+// Resolve accepts a deezer.com URL (track/album/artist/playlist pages,
+// a user's "loved tracks" page, or a deezer.page.link share link), or a
+// raw `isrc:XXX` / `upc:XXX` identifier, and fetches the resource it
+// points to.
+func (c *Client) Resolve(ctx context.Context, rawURL string) (Resource, error) {
+	switch {
+	case strings.HasPrefix(rawURL, "isrc:"):
+		id, err := c.lookupPublicID(ctx, "track/isrc:"+strings.TrimPrefix(rawURL, "isrc:"))
+		if err != nil {
+			return Resource{}, err
+		}
+		song, err := c.Song(ctx, id)
+		return Resource{Song: song}, err
+	case strings.HasPrefix(rawURL, "upc:"):
+		id, err := c.lookupPublicID(ctx, "album/upc:"+strings.TrimPrefix(rawURL, "upc:"))
+		if err != nil {
+			return Resource{}, err
+		}
+		album, err := c.Album(ctx, id)
+		return Resource{Album: album}, err
+	}
+
+	resolved, err := c.followRedirects(ctx, rawURL)
+	if err != nil {
+		return Resource{}, err
+	}
+
+	if m := lovedPath.FindStringSubmatch(resolved); m != nil {
+		var songs multiSongResponse
+		if err := c.apiDoJSON(ctx, userFavoriteSongs, userFavoriteSongsBody{m[1]}, &songs); err != nil {
+			return Resource{}, err
+		}
+		return Resource{Playlist: &Playlist{Title: "Loved Tracks", NbSongs: len(songs.Data), Songs: struct {
+			Data []Song `json:"data"`
+		}{songs.Data}}}, nil
+	}
+
+	m := resourcePath.FindStringSubmatch(resolved)
+	if m == nil {
+		return Resource{}, fmt.Errorf("deezer: could not resolve %q to a known resource", rawURL)
+	}
+	kind, id := m[1], m[2]
+	switch kind {
+	case "track":
+		song, err := c.Song(ctx, id)
+		return Resource{Song: song}, err
+	case "album":
+		album, err := c.Album(ctx, id)
+		return Resource{Album: album}, err
+	case "artist":
+		artist, err := c.Artist(ctx, id)
+		return Resource{Artist: artist}, err
+	case "playlist":
+		playlist, err := c.Playlist(ctx, id)
+		return Resource{Playlist: playlist}, err
+	default:
+		return Resource{}, fmt.Errorf("deezer: unsupported resource kind %q", kind)
+	}
+}
+
+// followRedirects returns the final URL rawURL redirects to, following
+// deezer.page.link share links through to their deezer.com destination.
+// URLs that don't need resolving are returned unchanged.
+func (c *Client) followRedirects(ctx context.Context, rawURL string) (string, error) {
+	if !strings.Contains(rawURL, shortLinkHost) {
+		return rawURL, nil
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", rawURL, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := c.do(req)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	return resp.Request.URL.String(), nil
+}
+
+// lookupPublicID resolves a path on Deezer's public API (e.g.
+// "track/isrc:XXX") to the numeric id used by the gw-light methods.
+func (c *Client) lookupPublicID(ctx context.Context, path string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", publicAPIURL+"/"+path, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := c.do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return "", ErrUnexpectedStatusCode{resp.StatusCode}
+	}
+	var v struct {
+		ID int `json:"id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&v); err != nil {
+		return "", err
+	}
+	if v.ID == 0 {
+		return "", fmt.Errorf("deezer: no resource found for %q", path)
+	}
+	return fmt.Sprint(v.ID), nil
+}
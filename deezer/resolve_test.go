@@ -0,0 +1,54 @@
+package deezer
+
+import "testing"
+
+func TestResourcePathMatches(t *testing.T) {
+	cases := []struct {
+		url      string
+		wantKind string
+		wantID   string
+	}{
+		{"https://www.deezer.com/en/track/123456789", "track", "123456789"},
+		{"https://www.deezer.com/us/album/987654321", "album", "987654321"},
+		{"https://www.deezer.com/fr/artist/42", "artist", "42"},
+		{"https://www.deezer.com/en/playlist/1122334455", "playlist", "1122334455"},
+	}
+	for _, c := range cases {
+		m := resourcePath.FindStringSubmatch(c.url)
+		if m == nil {
+			t.Errorf("resourcePath didn't match %q", c.url)
+			continue
+		}
+		if m[1] != c.wantKind || m[2] != c.wantID {
+			t.Errorf("resourcePath.FindStringSubmatch(%q) = %v, want kind %q id %q", c.url, m, c.wantKind, c.wantID)
+		}
+	}
+}
+
+func TestResourcePathNoMatch(t *testing.T) {
+	for _, url := range []string{
+		"https://www.deezer.com/en/track/",
+		"https://www.deezer.com/en/show/123",
+		"https://example.com/not-deezer",
+	} {
+		if m := resourcePath.FindStringSubmatch(url); m != nil {
+			t.Errorf("resourcePath unexpectedly matched %q: %v", url, m)
+		}
+	}
+}
+
+func TestLovedPathMatches(t *testing.T) {
+	m := lovedPath.FindStringSubmatch("https://www.deezer.com/en/user/13371337/loved")
+	if m == nil {
+		t.Fatal("lovedPath didn't match a well-formed loved-tracks URL")
+	}
+	if m[1] != "13371337" {
+		t.Errorf("lovedPath matched user id %q, want %q", m[1], "13371337")
+	}
+}
+
+func TestLovedPathNoMatch(t *testing.T) {
+	if m := lovedPath.FindStringSubmatch("https://www.deezer.com/en/user/13371337"); m != nil {
+		t.Errorf("lovedPath unexpectedly matched a user URL with no /loved suffix: %v", m)
+	}
+}
@@ -0,0 +1,58 @@
+package deezer
+
+import (
+	"context"
+	"io"
+	"net/http"
+
+	"github.com/GoDeezer/lib/deezer/tag"
+)
+
+// TagOptions configures the metadata WriteTagged embeds into a
+// downloaded song.
+type TagOptions struct {
+	tag.Options
+
+	// LRC, if non-nil, additionally receives a `.lrc` sidecar rendering
+	// of Options.Synced, with `[mm:ss.xx]` timestamps.
+	LRC io.Writer
+
+	// Download configures the underlying concurrent downloader, same as
+	// the opts passed to Song.Write.
+	Download DownloadOptions
+}
+
+// WriteTagged writes a song from Deezer at a given quality to w, same
+// as Write, but first muxes in the metadata and cover art described by
+// opts: an ID3v2.4 tag for MP3, or Vorbis comments plus an embedded
+// PICTURE block for FLAC. Like Write, it fetches the encrypted stream
+// across concurrent range requests via opts.Download, though it always
+// downloads from the start: a tagged file's header depends on the full
+// stream, so there's nothing to usefully resume. The download can be
+// cancelled by cancelling ctx.
+func (s Song) WriteTagged(ctx context.Context, w io.Writer, quality Quality, opts TagOptions) error {
+	url := s.DownloadURL(quality)
+	total, err := contentLength(ctx, http.DefaultClient, url)
+	if err != nil {
+		return err
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(fetchRangesTo(ctx, http.DefaultClient, url, 0, total, s.ID, pw, opts.Download))
+	}()
+
+	if quality == FLAC {
+		err = tag.WriteFLAC(w, pr, opts.Options)
+	} else {
+		err = tag.WriteMP3(w, pr, opts.Options)
+	}
+	if err != nil {
+		return err
+	}
+
+	if opts.LRC != nil && len(opts.Synced) > 0 {
+		_, err = io.WriteString(opts.LRC, tag.FormatLRC(opts.Synced))
+	}
+	return err
+}
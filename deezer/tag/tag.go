@@ -0,0 +1,218 @@
+// Package tag writes ID3v2 and FLAC Vorbis-comment metadata (plus
+// embedded cover art and synced lyrics) into the audio streams produced
+// by the deezer package's decrypting readers.
+package tag
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/bogem/id3v2/v2"
+	"github.com/go-flac/flacpicture/v2"
+	"github.com/go-flac/flacvorbis/v2"
+	flac "github.com/go-flac/go-flac/v2"
+)
+
+// LyricLine is a single synchronized lyric line, timestamped from the
+// start of the track.
+type LyricLine struct {
+	// Offset is the line's timestamp in milliseconds.
+	Offset int
+	Text   string
+}
+
+// Options carries the metadata to embed. All fields are optional except
+// Title; a zero value is simply omitted from the output tags.
+type Options struct {
+	Title         string
+	Artists       []string
+	Album         string
+	AlbumArtist   string
+	TrackNumber   int
+	TrackTotal    int
+	DiscNumber    int
+	DiscTotal     int
+	ISRC          string
+	ReleaseDate   string
+	Genres        []string
+	BPM           int
+	ReplayGain    float64
+	HasReplayGain bool
+
+	// Cover is the raw bytes of a cover image (JPEG or PNG) to embed.
+	Cover     []byte
+	CoverMIME string
+
+	// Lyrics is the plain, unsynced lyric text.
+	Lyrics string
+	// Synced is the synced lyric track, if available. WriteFLAC embeds
+	// it as an LRC-formatted LYRICS comment alongside Lyrics rather than
+	// in place of it; WriteMP3 does not embed it.
+	Synced []LyricLine
+}
+
+// WriteMP3 copies audio to w, prefixed with an ID3v2.4 tag built from
+// opts. audio must already be decrypted/decoded MP3 data.
+func WriteMP3(w io.Writer, audio io.Reader, opts Options) error {
+	t := id3v2.NewEmptyTag()
+	t.SetVersion(4)
+	t.SetDefaultEncoding(id3v2.EncodingUTF8)
+	t.SetTitle(opts.Title)
+	if len(opts.Artists) > 0 {
+		t.SetArtist(joinArtists(opts.Artists))
+	}
+	t.SetAlbum(opts.Album)
+	if opts.AlbumArtist != "" {
+		t.AddTextFrame(t.CommonID("Band/Orchestra/Accompaniment"), t.DefaultEncoding(), opts.AlbumArtist)
+	}
+	if opts.TrackNumber > 0 {
+		t.AddTextFrame(t.CommonID("Track number/Position in set"), t.DefaultEncoding(), trackPosition(opts.TrackNumber, opts.TrackTotal))
+	}
+	if opts.DiscNumber > 0 {
+		t.AddTextFrame(t.CommonID("Part of a set"), t.DefaultEncoding(), trackPosition(opts.DiscNumber, opts.DiscTotal))
+	}
+	if opts.ISRC != "" {
+		t.AddTextFrame(t.CommonID("ISRC"), t.DefaultEncoding(), opts.ISRC)
+	}
+	if opts.ReleaseDate != "" {
+		t.SetYear(opts.ReleaseDate)
+	}
+	if len(opts.Genres) > 0 {
+		t.SetGenre(joinArtists(opts.Genres))
+	}
+	if opts.BPM > 0 {
+		t.AddTextFrame(t.CommonID("BPM"), t.DefaultEncoding(), fmt.Sprint(opts.BPM))
+	}
+	if opts.HasReplayGain {
+		t.AddUserDefinedTextFrame(id3v2.UserDefinedTextFrame{
+			Encoding:    t.DefaultEncoding(),
+			Description: "REPLAYGAIN_TRACK_GAIN",
+			Value:       fmt.Sprintf("%.2f dB", opts.ReplayGain),
+		})
+	}
+	if opts.Lyrics != "" {
+		t.AddUnsynchronisedLyricsFrame(id3v2.UnsynchronisedLyricsFrame{
+			Encoding:          t.DefaultEncoding(),
+			Language:          "eng",
+			ContentDescriptor: "",
+			Lyrics:            opts.Lyrics,
+		})
+	}
+	// Synced lyrics have no home in ID3v2 here: the id3v2 library this
+	// package uses has no SYLT (synchronised lyrics) frame support, so
+	// opts.Synced is only ever embedded via the .lrc sidecar that
+	// callers can request through TagOptions.LRC.
+	if len(opts.Cover) > 0 {
+		t.AddAttachedPicture(id3v2.PictureFrame{
+			Encoding:    t.DefaultEncoding(),
+			MimeType:    coverMIME(opts),
+			PictureType: id3v2.PTFrontCover,
+			Picture:     opts.Cover,
+		})
+	}
+	if _, err := t.WriteTo(w); err != nil {
+		return err
+	}
+	_, err := io.Copy(w, audio)
+	return err
+}
+
+// WriteFLAC copies audio to w as a FLAC stream with Vorbis comments and
+// a PICTURE metadata block built from opts. audio must be a raw,
+// un-decoded FLAC stream (frame headers and all).
+func WriteFLAC(w io.Writer, audio io.Reader, opts Options) error {
+	f, err := flac.ParseBytes(audio)
+	if err != nil {
+		return err
+	}
+
+	comments := flacvorbis.New()
+	comments.Add(flacvorbis.FIELD_TITLE, opts.Title)
+	for _, artist := range opts.Artists {
+		comments.Add(flacvorbis.FIELD_ARTIST, artist)
+	}
+	comments.Add(flacvorbis.FIELD_ALBUM, opts.Album)
+	if opts.AlbumArtist != "" {
+		comments.Add("ALBUMARTIST", opts.AlbumArtist)
+	}
+	if opts.TrackNumber > 0 {
+		comments.Add(flacvorbis.FIELD_TRACKNUMBER, fmt.Sprint(opts.TrackNumber))
+	}
+	if opts.DiscNumber > 0 {
+		comments.Add("DISCNUMBER", fmt.Sprint(opts.DiscNumber))
+	}
+	if opts.ISRC != "" {
+		comments.Add("ISRC", opts.ISRC)
+	}
+	if opts.ReleaseDate != "" {
+		comments.Add(flacvorbis.FIELD_DATE, opts.ReleaseDate)
+	}
+	for _, genre := range opts.Genres {
+		comments.Add(flacvorbis.FIELD_GENRE, genre)
+	}
+	if opts.BPM > 0 {
+		comments.Add("BPM", fmt.Sprint(opts.BPM))
+	}
+	if opts.HasReplayGain {
+		comments.Add("REPLAYGAIN_TRACK_GAIN", fmt.Sprintf("%.2f dB", opts.ReplayGain))
+	}
+	if opts.Lyrics != "" {
+		comments.Add("LYRICS", opts.Lyrics)
+	}
+	if len(opts.Synced) > 0 {
+		comments.Add("LYRICS", FormatLRC(opts.Synced))
+	}
+	commentsMeta := comments.Marshal()
+	f.Meta = append(f.Meta, &commentsMeta)
+
+	if len(opts.Cover) > 0 {
+		pic, err := flacpicture.NewFromImageData(flacpicture.PictureTypeFrontCover, "", opts.Cover, coverMIME(opts))
+		if err != nil {
+			return err
+		}
+		picMeta := pic.Marshal()
+		f.Meta = append(f.Meta, &picMeta)
+	}
+
+	_, err = f.WriteTo(w)
+	return err
+}
+
+// FormatLRC renders lines as a `.lrc` sidecar: one `[mm:ss.xx]text` line
+// per entry, in order.
+func FormatLRC(lines []LyricLine) string {
+	var b bytes.Buffer
+	for _, l := range lines {
+		minutes := l.Offset / 60000
+		seconds := (l.Offset / 1000) % 60
+		centis := (l.Offset % 1000) / 10
+		fmt.Fprintf(&b, "[%02d:%02d.%02d]%s\n", minutes, seconds, centis, l.Text)
+	}
+	return b.String()
+}
+
+func joinArtists(parts []string) string {
+	var b bytes.Buffer
+	for i, p := range parts {
+		if i > 0 {
+			b.WriteString("; ")
+		}
+		b.WriteString(p)
+	}
+	return b.String()
+}
+
+func trackPosition(n, total int) string {
+	if total > 0 {
+		return fmt.Sprintf("%d/%d", n, total)
+	}
+	return fmt.Sprint(n)
+}
+
+func coverMIME(opts Options) string {
+	if opts.CoverMIME != "" {
+		return opts.CoverMIME
+	}
+	return "image/jpeg"
+}
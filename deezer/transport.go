@@ -0,0 +1,161 @@
+package deezer
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ClientOption configures optional middleware on a Client's transport
+// chain. WithRoundTripper options are applied in the order given to
+// NewClientWithOptions, each wrapping whatever transport came before
+// it. WithRetry and WithRateLimit are special-cased: whichever order
+// they're passed in, the rate limiter always ends up wrapped by the
+// retry logic (never the other way around) once all options have run;
+// see WithRetry for why.
+type ClientOption func(*Client)
+
+// retryConfig is the config passed to WithRetry, recorded on the
+// Client so NewClientWithOptions can apply it last.
+type retryConfig struct {
+	maxRetries int
+	baseDelay  time.Duration
+}
+
+// WithRetry arranges for the Client's transport to retry with
+// exponential-backoff on 5xx responses and network errors, making up to
+// maxRetries retries after the initial attempt. The delay before retry
+// n is baseDelay * 2^(n-1), plus jitter.
+//
+// Retries are always the outermost layer of the transport chain, so
+// that a request retried after a 5xx still passes back through
+// WithRateLimit on every attempt rather than bypassing it: without
+// this, a 500-storm would make the retry loop hammer the server at
+// full speed, exactly when it's least able to take it.
+func WithRetry(maxRetries int, baseDelay time.Duration) ClientOption {
+	return func(c *Client) {
+		c.retry = &retryConfig{maxRetries: maxRetries, baseDelay: baseDelay}
+	}
+}
+
+// WithRateLimit arranges for the Client's transport to be limited by a
+// token-bucket limiter that allows rps requests per second on average,
+// with bursts of up to burst requests. Use this to stay under Deezer's
+// per-IP thresholds. See WithRetry for how retries compose with this.
+func WithRateLimit(rps float64, burst int) ClientOption {
+	return func(c *Client) {
+		c.rateLimiter = newTokenBucket(rps, burst)
+	}
+}
+
+// WithRoundTripper inserts a custom http.RoundTripper into the Client's
+// transport chain, in front of whatever transport was previously
+// configured. It's the escape hatch for logging, header injection, or
+// any other per-request hook callers need.
+func WithRoundTripper(wrap func(next http.RoundTripper) http.RoundTripper) ClientOption {
+	return func(c *Client) {
+		c.Client.Transport = wrap(c.transport())
+	}
+}
+
+// transport returns the Client's configured http.RoundTripper, falling
+// back to http.DefaultTransport if none has been set.
+func (c *Client) transport() http.RoundTripper {
+	if c.Client.Transport != nil {
+		return c.Client.Transport
+	}
+	return http.DefaultTransport
+}
+
+type retryTransport struct {
+	next       http.RoundTripper
+	maxRetries int
+	baseDelay  time.Duration
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var resp *http.Response
+	var err error
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 && req.GetBody != nil {
+			body, berr := req.GetBody()
+			if berr != nil {
+				return nil, berr
+			}
+			req.Body = body
+		}
+		resp, err = t.next.RoundTrip(req)
+		retriable := err != nil || (resp != nil && resp.StatusCode >= 500)
+		if !retriable || attempt >= t.maxRetries {
+			return resp, err
+		}
+		if resp != nil {
+			resp.Body.Close()
+		}
+		delay := t.baseDelay * time.Duration(1<<uint(attempt))
+		delay += time.Duration(rand.Int63n(int64(t.baseDelay) + 1))
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+type rateLimitTransport struct {
+	next    http.RoundTripper
+	limiter *tokenBucket
+}
+
+func (t *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.limiter.wait(req.Context()); err != nil {
+		return nil, err
+	}
+	return t.next.RoundTrip(req)
+}
+
+// tokenBucket is a minimal token-bucket rate limiter; it exists so
+// Client doesn't have to depend on golang.org/x/time/rate for a single
+// use site.
+type tokenBucket struct {
+	mu       sync.Mutex
+	rps      float64
+	burst    float64
+	tokens   float64
+	lastFill time.Time
+}
+
+func newTokenBucket(rps float64, burst int) *tokenBucket {
+	return &tokenBucket{
+		rps:      rps,
+		burst:    float64(burst),
+		tokens:   float64(burst),
+		lastFill: time.Now(),
+	}
+}
+
+func (b *tokenBucket) wait(ctx context.Context) error {
+	for {
+		b.mu.Lock()
+		now := time.Now()
+		b.tokens += now.Sub(b.lastFill).Seconds() * b.rps
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+		b.lastFill = now
+		if b.tokens >= 1 {
+			b.tokens--
+			b.mu.Unlock()
+			return nil
+		}
+		wait := time.Duration((1 - b.tokens) / b.rps * float64(time.Second))
+		b.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package deezer
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTokenBucketLimitsRate(t *testing.T) {
+	b := newTokenBucket(1000, 1)
+	ctx := context.Background()
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := b.wait(ctx); err != nil {
+			t.Fatalf("wait %d: %v", i, err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < time.Millisecond {
+		t.Errorf("3 requests against a burst-1, 1000rps bucket returned in %v, expected at least ~2ms of throttling", elapsed)
+	}
+}
+
+func TestTokenBucketRespectsContext(t *testing.T) {
+	b := newTokenBucket(1, 1)
+	if err := b.wait(context.Background()); err != nil {
+		t.Fatalf("first wait (should consume the burst token for free): %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := b.wait(ctx); err == nil {
+		t.Error("wait on an empty bucket with a short-lived context: got nil error, want context deadline exceeded")
+	}
+}
+
+func TestRetryTransportRetriesOn5xx(t *testing.T) {
+	var attempts int32
+	rt := &retryTransport{
+		next: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			n := atomic.AddInt32(&attempts, 1)
+			if n < 3 {
+				rec := httptest.NewRecorder()
+				rec.Code = http.StatusServiceUnavailable
+				return rec.Result(), nil
+			}
+			rec := httptest.NewRecorder()
+			rec.Code = http.StatusOK
+			return rec.Result(), nil
+		}),
+		maxRetries: 5,
+		baseDelay:  time.Millisecond,
+	}
+	req := httptest.NewRequest("GET", "http://example.invalid/", nil)
+	resp, err := rt.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("RoundTrip: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("final status = %d, want 200", resp.StatusCode)
+	}
+	if attempts != 3 {
+		t.Errorf("attempts = %d, want 3", attempts)
+	}
+}
+
+func TestRetryTransportStopsAtMaxRetries(t *testing.T) {
+	var attempts int32
+	rt := &retryTransport{
+		next: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			atomic.AddInt32(&attempts, 1)
+			rec := httptest.NewRecorder()
+			rec.Code = http.StatusInternalServerError
+			return rec.Result(), nil
+		}),
+		maxRetries: 2,
+		baseDelay:  time.Millisecond,
+	}
+	req := httptest.NewRequest("GET", "http://example.invalid/", nil)
+	resp, err := rt.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("RoundTrip: %v", err)
+	}
+	if resp.StatusCode != http.StatusInternalServerError {
+		t.Errorf("final status = %d, want 500", resp.StatusCode)
+	}
+	if attempts != 3 {
+		t.Errorf("attempts = %d, want 3 (1 initial + 2 retries)", attempts)
+	}
+}
+
+// TestRetryReentersRateLimiter is the regression test for the ordering
+// bug: NewClientWithOptions must always apply the rate limiter inside
+// the retry transport, regardless of the order WithRetry/WithRateLimit
+// were passed in, so that every retry attempt re-enters the limiter.
+func TestRetryReentersRateLimiter(t *testing.T) {
+	var serverHits int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&serverHits, 1)
+		if n <= 3 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	c := NewClientWithOptions("", &http.Client{}, WithRetry(5, time.Millisecond), WithRateLimit(5, 1))
+
+	start := time.Now()
+	resp, err := c.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("final status = %d, want 200", resp.StatusCode)
+	}
+	// 4 requests total (3 failures + 1 success) against a 5req/s, burst-1
+	// limiter should take at least ~600ms if retries re-enter the
+	// limiter. Without the fix, all 4 complete in a few milliseconds.
+	if elapsed := time.Since(start); elapsed < 600*time.Millisecond {
+		t.Errorf("4 requests against a 5rps limiter completed in %v, want retries throttled to roughly 1 every 200ms", elapsed)
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }